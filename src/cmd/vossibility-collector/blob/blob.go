@@ -0,0 +1,55 @@
+// Package blob defines the normalized, storage-ready representation of a
+// synchronized GitHub item.
+package blob
+
+import (
+	"io"
+	"io/ioutil"
+
+	json "github.com/goccy/go-json"
+)
+
+// Blob is a normalized, storage-ready representation of a GitHub item.
+type Blob struct {
+	id      string
+	kind    string
+	payload json.RawMessage
+}
+
+// ID returns the unique identifier of the blob.
+func (b *Blob) ID() string {
+	return b.id
+}
+
+// Type returns the kind of item the blob was built from (e.g. "issue",
+// "pull_request").
+func (b *Blob) Type() string {
+	return b.kind
+}
+
+// Payload returns the raw JSON payload backing the blob.
+func (b *Blob) Payload() json.RawMessage {
+	return b.payload
+}
+
+// NewBlobFromPayload creates a Blob of the given kind and id from a raw JSON
+// payload.
+func NewBlobFromPayload(kind, id string, payload []byte) (*Blob, error) {
+	var raw json.RawMessage
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, err
+	}
+	return &Blob{id: id, kind: kind, payload: raw}, nil
+}
+
+// NewBlobFromReader creates a Blob of the given kind and id by reading its
+// JSON payload from r, bypassing the marshal-then-unmarshal round trip
+// NewBlobFromPayload requires when the caller already holds raw bytes (e.g.
+// a GitHub HTTP response body).
+func NewBlobFromReader(kind, id string, r io.Reader) (*Blob, error) {
+	payload, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewBlobFromPayload(kind, id, payload)
+}
@@ -0,0 +1,67 @@
+package blob
+
+import (
+	stdjson "encoding/json"
+	"testing"
+
+	json "github.com/goccy/go-json"
+)
+
+// issueFixture is a trimmed but representative real GitHub issue payload, as
+// returned by the Issues.ListByRepo endpoint exercised in
+// github.fetchRepositoryItems.
+const issueFixture = `{
+	"id": 123456789,
+	"number": 4242,
+	"state": "open",
+	"title": "panic: runtime error: index out of range in daemon/graphdriver/overlay2",
+	"body": "### Description\n\nSome long form markdown body describing the bug in detail, including repro steps, expected behavior, and actual behavior observed in production.\n\n### Steps to reproduce\n\n1. docker build .\n2. docker run ...\n",
+	"user": {"login": "someuser", "id": 1000001, "type": "User"},
+	"labels": [
+		{"name": "kind/bug", "color": "ee0701"},
+		{"name": "area/graphdriver", "color": "c7def8"},
+		{"name": "version/1.13", "color": "bfd4f2"}
+	],
+	"assignees": [
+		{"login": "maintainer1", "id": 1000002, "type": "User"},
+		{"login": "maintainer2", "id": 1000003, "type": "User"}
+	],
+	"milestone": {"title": "1.13.2", "number": 99},
+	"comments": 12,
+	"created_at": "2016-11-02T10:00:00Z",
+	"updated_at": "2016-11-05T18:32:00Z",
+	"closed_at": null,
+	"html_url": "https://github.com/docker/docker/issues/4242"
+}`
+
+func BenchmarkUnmarshalEncodingJSON(b *testing.B) {
+	b.ReportAllocs()
+	payload := []byte(issueFixture)
+	for i := 0; i != b.N; i++ {
+		var raw stdjson.RawMessage
+		if err := stdjson.Unmarshal(payload, &raw); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalGoJSON(b *testing.B) {
+	b.ReportAllocs()
+	payload := []byte(issueFixture)
+	for i := 0; i != b.N; i++ {
+		var raw json.RawMessage
+		if err := json.Unmarshal(payload, &raw); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkNewBlobFromPayload(b *testing.B) {
+	b.ReportAllocs()
+	payload := []byte(issueFixture)
+	for i := 0; i != b.N; i++ {
+		if _, err := NewBlobFromPayload("issue", "4242", payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
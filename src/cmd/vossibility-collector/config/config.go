@@ -0,0 +1,74 @@
+// Package config loads the multi-repository configuration file describing
+// every GitHub repository the collector should synchronize, along with its
+// own sync schedule.
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"cmd/vossibility-collector/github"
+	"cmd/vossibility-collector/storage"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// RepositoryConfig describes a single repository to track, along with the
+// sync options and cadence specific to it.
+type RepositoryConfig struct {
+	// Name is the "user/repo" slug of the tracked repository.
+	Name string `yaml:"name"`
+
+	// State filters which issues and pull requests are retrieved.
+	State github.GitHubStateFilter `yaml:"state"`
+
+	// From is the index to start syncing from.
+	From int `yaml:"from"`
+
+	// PerPage is the number of GitHub items to query per page.
+	PerPage int `yaml:"per_page"`
+
+	// SleepPerPage is the number of seconds to sleep between each page
+	// queried, to avoid triggering GitHub's abuse detection mechanism.
+	SleepPerPage int `yaml:"sleep_per_page"`
+
+	// Storage is the destination store for this repository's data.
+	Storage storage.Storage `yaml:"storage"`
+
+	// SyncInterval is the cadence at which this repository is resynchronized,
+	// expressed as a duration string such as "5m" or "15m".
+	SyncInterval string `yaml:"sync_interval"`
+}
+
+// Interval parses SyncInterval into a time.Duration.
+func (r *RepositoryConfig) Interval() (time.Duration, error) {
+	if r.SyncInterval == "" {
+		return 0, fmt.Errorf("repository %q: sync_interval is required", r.Name)
+	}
+	return time.ParseDuration(r.SyncInterval)
+}
+
+// Config is the root of the multi-repository configuration file.
+type Config struct {
+	Repositories []RepositoryConfig `yaml:"repositories"`
+}
+
+// Load reads and parses the configuration file at path.
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var c Config
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("parsing config %s: %v", path, err)
+	}
+	for i := range c.Repositories {
+		if _, err := c.Repositories[i].Interval(); err != nil {
+			return nil, err
+		}
+	}
+	return &c, nil
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTempConfig(t *testing.T, contents string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "config_test")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("unexpected error writing temp config: %v", err)
+	}
+	return path
+}
+
+func TestLoadParsesRepositories(t *testing.T) {
+	path := writeTempConfig(t, `
+repositories:
+  - name: vmg/sundown
+    sync_interval: 5m
+  - name: docker/docker
+    state: closed
+    sync_interval: 15m
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Repositories) != 2 {
+		t.Fatalf("expected 2 repositories, got %d", len(cfg.Repositories))
+	}
+	if cfg.Repositories[0].Name != "vmg/sundown" {
+		t.Fatalf("unexpected first repository: %+v", cfg.Repositories[0])
+	}
+}
+
+func TestLoadRejectsMissingSyncInterval(t *testing.T) {
+	path := writeTempConfig(t, `
+repositories:
+  - name: vmg/sundown
+`)
+
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected an error for a repository missing sync_interval")
+	}
+}
+
+func TestLoadRejectsInvalidSyncInterval(t *testing.T) {
+	path := writeTempConfig(t, `
+repositories:
+  - name: vmg/sundown
+    sync_interval: not-a-duration
+`)
+
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected an error for an invalid sync_interval")
+	}
+}
+
+func TestLoadRejectsMalformedYAML(t *testing.T) {
+	path := writeTempConfig(t, "repositories: [this is not valid yaml")
+
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected an error for malformed YAML")
+	}
+}
+
+func TestLoadRejectsMissingFile(t *testing.T) {
+	if _, err := Load(filepath.Join(t.TempDir(), "does-not-exist.yaml")); err == nil {
+		t.Fatal("expected an error for a missing config file")
+	}
+}
@@ -0,0 +1,124 @@
+package github
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// Clock abstracts time so tests can inject a fake clock instead of waiting on
+// wall-clock time.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the Clock backed by the actual wall clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Limiter paces outgoing GitHub API requests so as to avoid triggering
+// secondary rate limiting, and reacts to the rate limit and abuse detection
+// signals GitHub sends back on every response.
+type Limiter interface {
+	// Wait blocks until a request may be issued, or ctx is done.
+	Wait(ctx context.Context) error
+
+	// Update adjusts the limiter's pacing from the rate limit headers of a
+	// completed response.
+	Update(resp *github.Response)
+
+	// Backoff instructs the limiter to hold off issuing any further request
+	// for the given duration, as requested by a 403/429 Retry-After.
+	Backoff(d time.Duration)
+}
+
+// AdaptiveLimiter is the default Limiter. It spreads the remaining request
+// quota evenly across the time left until the quota resets, and honors any
+// explicit Retry-After backoff until it elapses.
+type AdaptiveLimiter struct {
+	clock Clock
+
+	mu         sync.Mutex
+	remaining  int
+	reset      time.Time
+	retryAfter time.Time
+}
+
+// NewAdaptiveLimiter creates a Limiter that has no pacing constraints until
+// the first response is fed through Update. A nil clock defaults to the
+// real wall clock.
+func NewAdaptiveLimiter(clock Clock) *AdaptiveLimiter {
+	if clock == nil {
+		clock = realClock{}
+	}
+	return &AdaptiveLimiter{clock: clock}
+}
+
+// Wait blocks until the next request is allowed to be issued, given the
+// pacing and backoff state accumulated from prior responses.
+func (l *AdaptiveLimiter) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	wait := l.nextWait()
+	if wait <= 0 {
+		return nil
+	}
+	select {
+	case <-l.clock.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *AdaptiveLimiter) nextWait() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	if l.retryAfter.After(now) {
+		return l.retryAfter.Sub(now)
+	}
+
+	// Spread whatever quota remains evenly until it resets, rather than
+	// firing requests as fast as possible and risking abuse detection.
+	if l.remaining <= 0 || !l.reset.After(now) {
+		return 0
+	}
+	wait := l.reset.Sub(now) / time.Duration(l.remaining)
+
+	// Reserve this slot immediately, under the same lock, so concurrent
+	// callers each pace off a shrinking quota instead of all reading the
+	// same snapshot and computing the same wait: the next caller sees one
+	// fewer remaining and a (slightly) longer wait, staggering them across
+	// the reset window. Update still corrects for drift once the real
+	// response headers come back.
+	l.remaining--
+	return wait
+}
+
+// Update records the rate limit state of a completed response.
+func (l *AdaptiveLimiter) Update(resp *github.Response) {
+	if resp == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.remaining = resp.Rate.Remaining
+	l.reset = resp.Rate.Reset.Time
+}
+
+// Backoff holds off the next Wait for at least d.
+func (l *AdaptiveLimiter) Backoff(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := l.clock.Now().Add(d); until.After(l.retryAfter) {
+		l.retryAfter = until
+	}
+}
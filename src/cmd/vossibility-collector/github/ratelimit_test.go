@@ -0,0 +1,115 @@
+package github
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// fakeClock is a Clock whose Now() is manually advanced and whose After()
+// fires immediately, rather than waiting on real time.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(0, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	ch <- c.Now().Add(d)
+	return ch
+}
+
+func TestAdaptiveLimiterNoConstraintBeforeUpdate(t *testing.T) {
+	l := NewAdaptiveLimiter(newFakeClock())
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestAdaptiveLimiterSpreadsRemainingQuota(t *testing.T) {
+	clock := newFakeClock()
+	l := NewAdaptiveLimiter(clock)
+
+	l.Update(&github.Response{Rate: github.Rate{
+		Remaining: 2,
+		Reset:     github.Timestamp{Time: clock.Now().Add(10 * time.Second)},
+	}})
+
+	if got, want := l.nextWait(), 5*time.Second; got != want {
+		t.Fatalf("nextWait() = %v, want %v", got, want)
+	}
+}
+
+// TestAdaptiveLimiterStaggersConcurrentCallers reproduces the scenario of
+// several fetchFunc workers calling Wait at roughly the same time: without
+// each call reserving its own slot, they would all read the same
+// remaining/reset snapshot and compute (nearly) the same wait, firing
+// together instead of spread across the reset window.
+func TestAdaptiveLimiterStaggersConcurrentCallers(t *testing.T) {
+	clock := newFakeClock()
+	l := NewAdaptiveLimiter(clock)
+
+	l.Update(&github.Response{Rate: github.Rate{
+		Remaining: 4,
+		Reset:     github.Timestamp{Time: clock.Now().Add(4 * time.Second)},
+	}})
+
+	var waits []time.Duration
+	for i := 0; i < 4; i++ {
+		waits = append(waits, l.nextWait())
+	}
+
+	// 4s spread over 4, 3, 2, 1 remaining slots: 1s, 1.333s, 2s, 4s.
+	want := []time.Duration{time.Second, 1333333333 * time.Nanosecond, 2 * time.Second, 4 * time.Second}
+	for i := range want {
+		if waits[i] != want[i] {
+			t.Fatalf("waits = %v, want %v", waits, want)
+		}
+	}
+}
+
+func TestAdaptiveLimiterBackoffTakesPrecedence(t *testing.T) {
+	clock := newFakeClock()
+	l := NewAdaptiveLimiter(clock)
+
+	l.Update(&github.Response{Rate: github.Rate{
+		Remaining: 100,
+		Reset:     github.Timestamp{Time: clock.Now().Add(time.Hour)},
+	}})
+	l.Backoff(30 * time.Second)
+
+	if got, want := l.nextWait(), 30*time.Second; got != want {
+		t.Fatalf("nextWait() = %v, want %v", got, want)
+	}
+}
+
+func TestAdaptiveLimiterWaitRespectsCancellation(t *testing.T) {
+	l := NewAdaptiveLimiter(newFakeClock())
+	l.Backoff(time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := l.Wait(ctx); err != context.Canceled {
+		t.Fatalf("Wait() error = %v, want context.Canceled", err)
+	}
+}
@@ -1,14 +1,15 @@
 package github
 
 import (
-	"encoding/json"
-	"sync"
+	"context"
 	"time"
 
 	"cmd/vossibility-collector/blob"
 	"cmd/vossibility-collector/storage"
+	"cmd/vossibility-collector/worker"
 
 	log "github.com/Sirupsen/logrus"
+	json "github.com/goccy/go-json"
 	"github.com/google/go-github/github"
 )
 
@@ -56,7 +57,7 @@ const (
 )
 
 // DefaultSyncOptions is the default set of options for a synchronization job.
-var DefaultSyncOptions = syncOptions{
+var DefaultSyncOptions = SyncOptions{
 	From:          DefaultFrom,
 	NumFetchProcs: DefaultNumFetchProcs,
 	NumIndexProcs: DefaultNumIndexProcs,
@@ -68,18 +69,16 @@ var DefaultSyncOptions = syncOptions{
 
 // syncCmd is a synchronization job.
 type syncCmd struct {
-	blobStore storage.BlobStore
-	client    *github.Client
-	options   *syncOptions
-	toFetch   chan github.Issue
-	toIndex   chan githubIndexedItem
-	wgFetch   sync.WaitGroup
-	wgIndex   sync.WaitGroup
+	blobStore  storage.BlobStore
+	checkpoint storage.Checkpoint
+	client     *github.Client
+	limiter    Limiter
+	options    *SyncOptions
 }
 
-// syncOptions is the set of options that can be configured for a
+// SyncOptions is the set of options that can be configured for a
 // synchronization job.
-type syncOptions struct {
+type SyncOptions struct {
 	// From is the index to start syncing from. It can be useful for enormous
 	// repositories such as docker/docker to ignore anything past a certain
 	// number.
@@ -105,9 +104,16 @@ type syncOptions struct {
 
 	// Storage is the type of Storage to Index into.
 	Storage storage.Storage
+
+	// ResetCheckpoint discards any previously committed checkpoint for every
+	// synchronized repository before starting, forcing a full re-sync from
+	// From (or the repository's StartIndex) instead of resuming.
+	ResetCheckpoint bool
 }
 
-// NewSyncCommand creates a default configured synchronization job.
+// NewSyncCommand creates a default configured synchronization job. It does
+// not resume from a checkpoint; use NewSyncCommandWithOptions and
+// WithCheckpoint for that.
 func NewSyncCommand(client *github.Client, blobStore storage.BlobStore) *syncCmd {
 	return NewSyncCommandWithOptions(client, blobStore, &DefaultSyncOptions)
 }
@@ -116,87 +122,297 @@ func NewSyncCommand(client *github.Client, blobStore storage.BlobStore) *syncCmd
 // options set. Be careful when using that function to give meaningful values
 // to all options: it is recommand to start from a copy of DefaultSyncOptions
 // and modify what needs to be from there.
-func NewSyncCommandWithOptions(client *github.Client, blobStore storage.BlobStore, opt *syncOptions) *syncCmd {
+//
+// The returned job does not resume from a checkpoint; call WithCheckpoint on
+// it to enable resumable syncs.
+func NewSyncCommandWithOptions(client *github.Client, blobStore storage.BlobStore, opt *SyncOptions) *syncCmd {
 	return &syncCmd{
-		blobStore: blobStore,
-		client:    client,
-		options:   opt,
-		toFetch:   make(chan github.Issue, opt.NumFetchProcs),
-		toIndex:   make(chan githubIndexedItem, opt.NumIndexProcs),
+		blobStore:  blobStore,
+		checkpoint: storage.NopCheckpoint{},
+		client:     client,
+		limiter:    NewAdaptiveLimiter(nil),
+		options:    opt,
 	}
 }
 
+// WithCheckpoint sets the Checkpoint used to resume an interrupted sync
+// across runs, and returns s for chaining.
+func (s *syncCmd) WithCheckpoint(checkpoint storage.Checkpoint) *syncCmd {
+	s.checkpoint = checkpoint
+	return s
+}
+
+// WithLimiter sets the Limiter used to pace GitHub API calls, and returns s
+// for chaining. The default is an AdaptiveLimiter backed by the real clock.
+func (s *syncCmd) WithLimiter(limiter Limiter) *syncCmd {
+	s.limiter = limiter
+	return s
+}
+
 // Run the synchronization job on the specified repositories. The command From
 // options overrides any per-repository starting index.
 //
-// This function starts NumIndexProcs indexing goroutines and NumFetchProcs
-// fetching goroutines, but won't return until all job is done, or a fatal
-// error occurs.
+// Each repository gets its own fetch Pool and index Pool for the duration of
+// its sync, wired so the fetch pool's output feeds the index pool's input.
+// Run won't return until all job is done, a fatal error occurs, or ctx is
+// done.
 //
 // Isolated errors (failure to retrieve a particular item, or failure to write
-// to the backend) will not interrupt the job. Only the inability to list items
-// from GitHub can interrupt prematurely (such as in case of rate limiting).
-func (s *syncCmd) Run(repos []*storage.Repository) {
+// to the backend) are logged but do not interrupt the job; they are still
+// surfaced to the caller by logging every worker.Result with a non-nil Err.
+// Only the inability to list items from GitHub, or the cancellation of ctx,
+// can interrupt prematurely (such as a user-triggered shutdown). A rate limit
+// error while listing is not such a failure: the page is retried once the
+// backoff elapses.
+func (s *syncCmd) Run(ctx context.Context, repos []*storage.Repository) error {
 	for _, r := range repos {
-		for i := 0; i != s.options.NumIndexProcs; i++ {
-			s.wgIndex.Add(1)
-			go s.indexingProc(r)
+		if err := s.syncRepository(ctx, r); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		for i := 0; i != s.options.NumFetchProcs; i++ {
-			s.wgFetch.Add(1)
-			go s.fetchingProc(r)
+func (s *syncCmd) syncRepository(ctx context.Context, r *storage.Repository) error {
+	fetchPool := worker.NewPool(s.options.NumFetchProcs, s.fetchFunc(r))
+	indexPool := worker.NewPool(s.options.NumIndexProcs, s.indexFunc(r))
+
+	fetchPool.Start(ctx)
+	indexPool.Start(ctx)
+
+	// Every fetched item (whether enriched from a pull request or not) is
+	// forwarded to the index pool as soon as it comes out of the fetch pool.
+	//
+	// The send to indexPool.In() is guarded by ctx.Done(): once ctx is
+	// cancelled, the index pool's own workers are free to exit without
+	// draining In (see worker.Pool), so this forwarder must stop trying to
+	// hand off results rather than block on a channel nobody reads anymore,
+	// which would otherwise leave it (and fetchPool.Out()) undrained.
+	//
+	// indexPool.In() is closed once below, centrally, after both this
+	// goroutine and fetchRepositoryItems (which also sends to it directly
+	// for plain issues) are done sending. Closing it here instead, on
+	// ctx.Done(), would race with fetchRepositoryItems' own in-flight sends
+	// and could panic with "send on closed channel".
+	forwarderDone := make(chan struct{})
+	go func() {
+		defer close(forwarderDone)
+		for res := range fetchPool.Out() {
+			if res.Err != nil {
+				log.Errorf("error fetching pull request for issue: %v", res.Err)
+				continue
+			}
+			select {
+			case indexPool.In() <- res.Result:
+			case <-ctx.Done():
+				return
+			}
 		}
+	}()
+
+	// The command line `--from` option override the configuration defined
+	// repository settings.
+	from := s.options.From
+	if from == 0 {
+		from = r.RepositoryConfig.StartIndex
+	}
 
-		// The command line `--from` option override the configuration defined
-		// repository settings.
-		from := s.options.From
-		if from == 0 {
-			from = r.RepositoryConfig.StartIndex
+	state := string(s.options.State)
+	if s.options.ResetCheckpoint {
+		if err := s.checkpoint.Commit(ctx, r, state, 0); err != nil {
+			log.Errorf("repository %s: error resetting checkpoint: %v", r.PrettyName(), err)
 		}
-		if err := s.fetchRepositoryItems(r, from, s.options.SleepPerPage, s.options.State); err != nil {
-			log.Errorf("error syncing repository %s issues: %v", r.PrettyName(), err)
+	} else if last, err := s.checkpoint.LastIndexed(ctx, r, state); err != nil {
+		log.Errorf("repository %s: error reading checkpoint: %v", r.PrettyName(), err)
+	} else if last+1 > from {
+		from = last + 1
+	}
+
+	// pageBatches reports, once every item of a page has been queued, how
+	// many items (len(iss)) to wait on before that page's highest issue
+	// number can be committed as the checkpoint. It is consumed below by the
+	// goroutine that drains indexPool.Out(), which is the only place that
+	// actually knows an item has been persisted.
+	pageBatches := make(chan pageBatch, s.options.NumIndexProcs)
+
+	// commitIndexedBatches must have consumed and committed every result
+	// before syncRepository returns: Wait only guarantees indexPool's
+	// workers are done sending into Out, not that this goroutine has
+	// drained it, so the caller must block on batchesDone rather than
+	// racing indexPool.Wait() against the last commit.
+	batchesDone := make(chan struct{})
+	go func() {
+		defer close(batchesDone)
+		s.commitIndexedBatches(ctx, r, state, indexPool.Out(), pageBatches)
+	}()
+
+	err := s.fetchRepositoryItems(ctx, r, from, s.options.SleepPerPage, s.options.State, fetchPool, indexPool, pageBatches)
+	if err != nil {
+		log.Errorf("error syncing repository %s issues: %v", r.PrettyName(), err)
+	}
+	close(pageBatches)
+
+	// fetchRepositoryItems has returned, so it will never send to
+	// indexPool.In() again; close it only once the forwarder, the other
+	// sender, is also done, then indexPool.Wait() and commitIndexedBatches
+	// can safely observe every item that was ever queued.
+	close(fetchPool.In())
+	fetchPool.Wait()
+	log.Warn("done fetching GitHub API data")
+
+	<-forwarderDone
+	close(indexPool.In())
+	indexPool.Wait()
+	log.Warn("done indexing documents in Elastic Search")
+
+	<-batchesDone
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// pageBatch reports that count items have been queued for indexing from a
+// single page of the GitHub issue listing, and that once all of them have
+// actually been persisted, last (the highest issue number among them) is
+// safe to commit as the checkpoint.
+type pageBatch struct {
+	last  int
+	count int
+}
+
+// commitIndexedBatches advances the checkpoint once every item of a pageBatch
+// has actually come back out of the index pool (whether successfully
+// persisted or not — a failed item is still logged and accounted for, so a
+// single bad item cannot wedge the checkpoint forever), rather than as soon
+// as a page is queued. Committing on queuing is unsafe: items queued from a
+// page can still be in flight through the fetch/index pools, and if the
+// process crashes or ctx is cancelled before they are indexed, advancing the
+// checkpoint past them would skip them for good on the next run instead of
+// re-fetching them.
+//
+// batches is closed once fetchRepositoryItems is done submitting pages;
+// indexed is closed once every indexing worker has exited. commitIndexedBatches
+// returns once both have drained.
+func (s *syncCmd) commitIndexedBatches(ctx context.Context, r *storage.Repository, state string, indexed <-chan worker.Result, batches <-chan pageBatch) {
+	var pending []pageBatch
+	unclaimed := 0
+
+	settle := func() {
+		for len(pending) > 0 && unclaimed > 0 {
+			take := unclaimed
+			if take > pending[0].count {
+				take = pending[0].count
+			}
+			pending[0].count -= take
+			unclaimed -= take
+			if pending[0].count > 0 {
+				return
+			}
+			if err := s.checkpoint.Commit(ctx, r, state, pending[0].last); err != nil {
+				log.Errorf("repository %s: error committing checkpoint: %v", r.PrettyName(), err)
+			}
+			pending = pending[1:]
 		}
+	}
 
-		// When fetchRepositoryItems is done, all data to fetch has been queued.
-		close(s.toFetch)
+	for indexed != nil || batches != nil {
+		select {
+		case res, ok := <-indexed:
+			if !ok {
+				indexed = nil
+				continue
+			}
+			if res.Err != nil {
+				log.Errorf("error indexing %v: %v", res.Job, res.Err)
+			}
+			unclaimed++
+			settle()
+		case b, ok := <-batches:
+			if !ok {
+				batches = nil
+				continue
+			}
+			pending = append(pending, b)
+			settle()
+		}
+	}
+}
 
-		// When the fetchingProc is done, all data to index has been queued.
-		s.wgFetch.Wait()
-		log.Warn("done fetching GitHub API data")
-		close(s.toIndex)
+// fetchFunc returns the worker.Func run by the fetch pool: it enriches an
+// issue that is really a pull request with the additional data only
+// available from the pull request endpoint.
+func (s *syncCmd) fetchFunc(r *storage.Repository) worker.Func {
+	return func(ctx context.Context, j worker.Job) (interface{}, error) {
+		i := j.(github.Issue)
+		log.Debugf("fetching associated pull request for issue %d", *i.Number)
 
-		// Wait until indexing completes.
-		s.wgIndex.Wait()
-		log.Warn("done indexing documents in Elastic Search")
+		// Pace the pull-request enrichment call the same way the issue
+		// listing call is paced below, since it counts against the same
+		// GitHub API quota.
+		if err := s.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
 
-		// we've closed the channels, but if the repo array is
-		// larger than 1, we need fresh channels for the next
-		// iteration of the for loop
-		s.toFetch = make(chan github.Issue, s.options.NumFetchProcs)
-		s.toIndex = make(chan githubIndexedItem, s.options.NumIndexProcs)
+		item, resp, err := pullRequestFromIssue(ctx, s.client, r, &i)
+		s.limiter.Update(resp)
+		if err != nil {
+			log.Errorf("fail to retrieve pull request information for %d: %v", *i.Number, err)
+			return githubIssue(i), nil
+		}
+		return item, nil
+	}
+}
+
+// indexFunc returns the worker.Func run by the index pool: it serializes a
+// githubIndexedItem back to a blob.Blob and persists it to the backend.
+func (s *syncCmd) indexFunc(r *storage.Repository) worker.Func {
+	return func(ctx context.Context, j worker.Job) (interface{}, error) {
+		i := j.(githubIndexedItem)
+
+		// We have to serialize back to JSON in order to transform the
+		// payload as we wish. This could be optimized out if we were to read
+		// the raw GitHub data rather than rely on the typed go-github
+		// package.
+		payload, err := json.Marshal(i)
+		if err != nil {
+			return nil, err
+		}
+		// We create a blob from the payload, which essentially deserialized
+		// the object back from JSON...
+		b, err := blob.NewBlobFromPayload(i.Type(), i.ID(), payload)
+		if err != nil {
+			return nil, err
+		}
+		// Persist the object in Elastic Search.
+		return nil, s.blobStore.Store(ctx, s.options.Storage, r, b)
 	}
 }
 
 // fetchRepositoryItems queries the GitHub API for all issues and pull requests
 // for a repository. Any failure to fetch a page interrupts the process and
-// returns the error.
+// returns the error, as does the cancellation of ctx, except for a rate limit
+// error, after which the same page is retried once the backoff elapses.
 //
-// The function lists all issues for the repository, and outputs in one of the
-// two job channels depending on the nature of the issue. Issues which are
-// effective issues are directly sent to the toIndex channel to be stored into
-// the Elastic Search backend. Issues which are effectively pull requests get
-// sent to the toFetch channel to be enriched by the fetchingProc before being
-// stored.
+// The function lists all issues for the repository, and submits each one to
+// one of the two pools depending on the nature of the issue. Issues which are
+// effective issues are sent directly to indexPool to be stored into the
+// Elastic Search backend. Issues which are effectively pull requests are sent
+// to fetchPool to be enriched before being stored.
 //
 // The motivation behind this design is that issues hold a part of the data,
 // some of which pull requests don't (in particular labels), but we still need
 // the information that are held by the pull request itself (such as additions
 // and deletions).
-func (s *syncCmd) fetchRepositoryItems(r *storage.Repository, from, sleepPerPage int, stateFilter GitHubStateFilter) error {
+func (s *syncCmd) fetchRepositoryItems(ctx context.Context, r *storage.Repository, from, sleepPerPage int, stateFilter GitHubStateFilter, fetchPool, indexPool *worker.Pool, pageBatches chan<- pageBatch) error {
 	count := 0
 	for page := from/s.options.PerPage + 1; page != 0; {
-		iss, resp, err := s.client.Issues.ListByRepo(r.User, r.Repo, &github.IssueListByRepoOptions{
+		if err := s.limiter.Wait(ctx); err != nil {
+			return err
+		}
+
+		iss, resp, err := s.client.Issues.ListByRepo(ctx, r.User, r.Repo, &github.IssueListByRepoOptions{
 			Direction: "asc", // List by created date ascending
 			Sort:      "created",
 			State:     string(stateFilter),
@@ -205,69 +421,77 @@ func (s *syncCmd) fetchRepositoryItems(r *storage.Repository, from, sleepPerPage
 				PerPage: 100,
 			},
 		})
+		s.limiter.Update(resp)
 		if err != nil {
+			// A secondary rate limit (403 abuse detection) or a primary rate
+			// limit (403/429) tells us exactly how long to back off for; wait
+			// it out and retry the same page rather than aborting the sync.
+			if aerr, ok := err.(*github.AbuseRateLimitError); ok {
+				wait := time.Minute
+				if aerr.RetryAfter != nil {
+					wait = *aerr.RetryAfter
+				}
+				log.Warnf("hit abuse rate limit fetching %s, backing off for %s", r.PrettyName(), wait)
+				s.limiter.Backoff(wait)
+				continue
+			}
+			if rlerr, ok := err.(*github.RateLimitError); ok {
+				wait := time.Until(rlerr.Rate.Reset.Time)
+				log.Warnf("hit rate limit fetching %s, backing off for %s", r.PrettyName(), wait)
+				s.limiter.Backoff(wait)
+				continue
+			}
 			return err
 		}
 
 		count += len(iss)
 		log.Infof("retrieved %d items for %s (page %d)", count, r.PrettyName(), page)
 
-		// If the issue is really a pull request, fetch it as such.
+		// If the issue is really a pull request, fetch it as such. Each send
+		// is guarded by ctx.Done() so a cancellation observed mid-page
+		// interrupts the hand-off immediately instead of blocking on a full
+		// channel.
+		last := 0
 		for _, i := range iss {
 			if i.PullRequestLinks == nil {
-				s.toIndex <- githubIssue(i)
+				select {
+				case indexPool.In() <- githubIssue(i):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
 			} else {
-				s.toFetch <- i
+				select {
+				case fetchPool.In() <- i:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			if *i.Number > last {
+				last = *i.Number
+			}
+		}
+
+		// Report this page's batch so the checkpoint is committed once every
+		// one of its items has actually been indexed, not merely queued: a
+		// crash or cancellation while items are still in flight through the
+		// fetch/index pools must not advance the checkpoint past them, or
+		// they would be silently skipped rather than re-fetched next run.
+		if last != 0 {
+			select {
+			case pageBatches <- pageBatch{last: last, count: len(iss)}:
+			case <-ctx.Done():
+				return ctx.Err()
 			}
 		}
 
 		page = resp.NextPage
 		if sleepPerPage > 0 {
-			time.Sleep(time.Duration(sleepPerPage) * time.Second)
+			select {
+			case <-time.After(time.Duration(sleepPerPage) * time.Second):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
 		}
 	}
 	return nil
 }
-
-// fetchingProc takes input from the toFetch channel and fetches additional
-// data for items were applicable. In particular, it gets the pull request
-// information for issues which are indeed pull requests.
-func (s *syncCmd) fetchingProc(r *storage.Repository) {
-	for i := range s.toFetch {
-		log.Debugf("fetching associated pull request for issue %d", *i.Number)
-		if item, err := pullRequestFromIssue(s.client, r, &i); err == nil {
-			s.toIndex <- item
-		} else {
-			s.toIndex <- githubIssue(i)
-			log.Errorf("fail to retrieve pull request information for %d: %v", *i.Number, err)
-		}
-	}
-	s.wgFetch.Done()
-}
-
-// indexingProc takes input from the toIndex channel and pushes the content to
-// the Elastic Search backend.
-func (s *syncCmd) indexingProc(r *storage.Repository) {
-	for i := range s.toIndex {
-		// We have to serialize back to JSON in order to transform the payload
-		// as we wish. This could be optimized out if we were to read the raw
-		// GitHub data rather than rely on the typed go-github package.
-		payload, err := json.Marshal(i)
-		if err != nil {
-			log.Errorf("error marshaling githubIndexedItem %q (%s): %v", i.ID(), i.Type(), err)
-			continue
-		}
-		// We create a blob from the payload, which essentially deserialized
-		// the object back from JSON...
-		b, err := blob.NewBlobFromPayload(i.Type(), i.ID(), payload)
-		if err != nil {
-			log.Errorf("creating blob from payload %q (%s): %v", i.ID(), i.Type(), err)
-			continue
-		}
-		// Persist the object in Elastic Search.
-		if err := s.blobStore.Store(s.options.Storage, r, b); err != nil {
-			log.Error(err)
-		}
-	}
-	s.wgIndex.Done()
-}
@@ -0,0 +1,145 @@
+package github
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cmd/vossibility-collector/storage"
+	"cmd/vossibility-collector/worker"
+)
+
+// fakeCheckpoint records every committed value, in order, instead of
+// persisting anything.
+type fakeCheckpoint struct {
+	commits []int
+}
+
+func (c *fakeCheckpoint) LastIndexed(ctx context.Context, r *storage.Repository, stateFilter string) (int, error) {
+	if len(c.commits) == 0 {
+		return 0, nil
+	}
+	return c.commits[len(c.commits)-1], nil
+}
+
+func (c *fakeCheckpoint) Commit(ctx context.Context, r *storage.Repository, stateFilter string, lastIndexed int) error {
+	c.commits = append(c.commits, lastIndexed)
+	return nil
+}
+
+func runCommitIndexedBatches(s *syncCmd, r *storage.Repository, indexed chan worker.Result, batches chan pageBatch) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		s.commitIndexedBatches(context.Background(), r, "open", indexed, batches)
+		close(done)
+	}()
+	return done
+}
+
+// TestCommitIndexedBatchesWaitsForFullBatch reproduces the resume-safety
+// requirement behind chunk0-4: the checkpoint must not advance until every
+// item queued for a page has actually come back out of the index pool, not
+// merely been queued for it.
+func TestCommitIndexedBatchesWaitsForFullBatch(t *testing.T) {
+	checkpoint := &fakeCheckpoint{}
+	s := &syncCmd{checkpoint: checkpoint}
+	r := &storage.Repository{User: "vmg", Repo: "sundown"}
+
+	indexed := make(chan worker.Result)
+	batches := make(chan pageBatch)
+	done := runCommitIndexedBatches(s, r, indexed, batches)
+
+	batches <- pageBatch{last: 10, count: 2}
+	indexed <- worker.Result{}
+
+	// Give the goroutine a chance to process the first result; with only
+	// one of the batch's two items accounted for, nothing should be
+	// committed yet.
+	time.Sleep(10 * time.Millisecond)
+	if len(checkpoint.commits) != 0 {
+		t.Fatalf("checkpoint committed %v before the full batch was indexed", checkpoint.commits)
+	}
+
+	indexed <- worker.Result{}
+	close(indexed)
+	close(batches)
+	<-done
+
+	if got, want := checkpoint.commits, []int{10}; len(got) != 1 || got[0] != want[0] {
+		t.Fatalf("commits = %v, want %v", got, want)
+	}
+}
+
+// TestCommitIndexedBatchesCountsErroredItems ensures a failed item still
+// counts toward its batch (a single bad item must not wedge the checkpoint
+// forever), while still only committing once the whole batch is accounted
+// for.
+func TestCommitIndexedBatchesCountsErroredItems(t *testing.T) {
+	checkpoint := &fakeCheckpoint{}
+	s := &syncCmd{checkpoint: checkpoint}
+	r := &storage.Repository{User: "vmg", Repo: "sundown"}
+
+	indexed := make(chan worker.Result)
+	batches := make(chan pageBatch)
+	done := runCommitIndexedBatches(s, r, indexed, batches)
+
+	batches <- pageBatch{last: 7, count: 1}
+	indexed <- worker.Result{Err: context.DeadlineExceeded}
+	close(indexed)
+	close(batches)
+	<-done
+
+	if got, want := checkpoint.commits, []int{7}; len(got) != 1 || got[0] != want[0] {
+		t.Fatalf("commits = %v, want %v", got, want)
+	}
+}
+
+// TestCommitIndexedBatchesHandlesCompletionsBeforeBatchAnnounced covers the
+// case where items finish indexing before fetchRepositoryItems reports their
+// page's batch (a fast index pool draining ahead of a slow fetch loop).
+func TestCommitIndexedBatchesHandlesCompletionsBeforeBatchAnnounced(t *testing.T) {
+	checkpoint := &fakeCheckpoint{}
+	s := &syncCmd{checkpoint: checkpoint}
+	r := &storage.Repository{User: "vmg", Repo: "sundown"}
+
+	indexed := make(chan worker.Result, 2)
+	batches := make(chan pageBatch, 1)
+	indexed <- worker.Result{}
+	indexed <- worker.Result{}
+	batches <- pageBatch{last: 3, count: 2}
+
+	done := runCommitIndexedBatches(s, r, indexed, batches)
+	close(indexed)
+	close(batches)
+	<-done
+
+	if got, want := checkpoint.commits, []int{3}; len(got) != 1 || got[0] != want[0] {
+		t.Fatalf("commits = %v, want %v", got, want)
+	}
+}
+
+// TestCommitIndexedBatchesCommitsSequentially verifies that batches are
+// committed in the order they were queued, even though completions across
+// batches may interleave.
+func TestCommitIndexedBatchesCommitsSequentially(t *testing.T) {
+	checkpoint := &fakeCheckpoint{}
+	s := &syncCmd{checkpoint: checkpoint}
+	r := &storage.Repository{User: "vmg", Repo: "sundown"}
+
+	indexed := make(chan worker.Result, 3)
+	batches := make(chan pageBatch, 2)
+	batches <- pageBatch{last: 10, count: 1}
+	batches <- pageBatch{last: 20, count: 2}
+	indexed <- worker.Result{}
+	indexed <- worker.Result{}
+	indexed <- worker.Result{}
+
+	done := runCommitIndexedBatches(s, r, indexed, batches)
+	close(indexed)
+	close(batches)
+	<-done
+
+	if got, want := checkpoint.commits, []int{10, 20}; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("commits = %v, want %v", got, want)
+	}
+}
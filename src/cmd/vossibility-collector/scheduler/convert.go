@@ -0,0 +1,48 @@
+package scheduler
+
+import (
+	"strings"
+
+	"cmd/vossibility-collector/config"
+	"cmd/vossibility-collector/github"
+	"cmd/vossibility-collector/storage"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// repositoryFromConfig builds the storage.Repository addressed by a
+// config.RepositoryConfig's "user/repo" Name.
+func repositoryFromConfig(rc config.RepositoryConfig) *storage.Repository {
+	parts := strings.SplitN(rc.Name, "/", 2)
+	if len(parts) != 2 {
+		log.Errorf("repository %q: expected a \"user/repo\" name", rc.Name)
+		return &storage.Repository{}
+	}
+	return &storage.Repository{
+		User: parts[0],
+		Repo: parts[1],
+		RepositoryConfig: storage.RepositoryConfig{
+			StartIndex: rc.From,
+		},
+	}
+}
+
+// syncOptionsFromConfig starts from github.DefaultSyncOptions and overrides
+// whatever the repository declares explicitly.
+func syncOptionsFromConfig(rc config.RepositoryConfig) github.SyncOptions {
+	opt := github.DefaultSyncOptions
+	if rc.State != "" {
+		opt.State = rc.State
+	}
+	if rc.PerPage != 0 {
+		opt.PerPage = rc.PerPage
+	}
+	opt.SleepPerPage = rc.SleepPerPage
+	if rc.Storage != "" {
+		opt.Storage = rc.Storage
+	}
+	if rc.From != 0 {
+		opt.From = rc.From
+	}
+	return opt
+}
@@ -0,0 +1,171 @@
+// Package scheduler runs a GitHub synchronization job against many
+// repositories, each on its own cadence, as declared by a config.Config.
+package scheduler
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"cmd/vossibility-collector/config"
+	"cmd/vossibility-collector/github"
+	"cmd/vossibility-collector/storage"
+
+	log "github.com/Sirupsen/logrus"
+	gogithub "github.com/google/go-github/github"
+)
+
+// Scheduler runs one sync loop per configured repository, each firing on its
+// own RepositoryConfig.SyncInterval, and supports reloading its repository
+// list without restarting the process.
+type Scheduler struct {
+	client    *gogithub.Client
+	blobStore storage.BlobStore
+	path      string
+
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+	running map[string]config.RepositoryConfig
+
+	wg sync.WaitGroup
+}
+
+// New creates a Scheduler that loads its repository list from the config
+// file at path.
+func New(client *gogithub.Client, blobStore storage.BlobStore, path string) *Scheduler {
+	return &Scheduler{
+		client:    client,
+		blobStore: blobStore,
+		path:      path,
+		cancels:   make(map[string]context.CancelFunc),
+		running:   make(map[string]config.RepositoryConfig),
+	}
+}
+
+// Run loads the configuration file and starts a sync loop per repository. It
+// blocks until ctx is done, reloading the repository set whenever the
+// process receives SIGHUP.
+func (s *Scheduler) Run(ctx context.Context) error {
+	if err := s.reload(ctx); err != nil {
+		return err
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-hup:
+			log.Info("received SIGHUP, reloading repository configuration")
+			if err := s.reload(ctx); err != nil {
+				log.Errorf("error reloading configuration %s: %v", s.path, err)
+			}
+		case <-ctx.Done():
+			s.wg.Wait()
+			return ctx.Err()
+		}
+	}
+}
+
+// diffRepositories compares the previously running configuration against the
+// newly loaded one and reports which repositories need a (re)started loop
+// and which need their loop stopped entirely. A repository is reported in
+// toStart both when it is new and when its configuration changed since
+// running was recorded; reload treats both the same way, cancelling any
+// existing loop for that name before starting a fresh one.
+func diffRepositories(running map[string]config.RepositoryConfig, cfg []config.RepositoryConfig) (toStart []config.RepositoryConfig, toStop []string) {
+	seen := make(map[string]bool, len(cfg))
+	for _, rc := range cfg {
+		seen[rc.Name] = true
+		if prev, ok := running[rc.Name]; !ok || prev != rc {
+			toStart = append(toStart, rc)
+		}
+	}
+	for name := range running {
+		if !seen[name] {
+			toStop = append(toStop, name)
+		}
+	}
+	return toStart, toStop
+}
+
+// reload re-reads the configuration file and starts or stops per-repository
+// loops so the running set matches what is declared. Repositories whose
+// configuration is unchanged keep running undisturbed; a repository whose
+// configuration was edited has its loop cancelled and restarted so the edit
+// takes effect, the same as if it had been removed and re-added.
+func (s *Scheduler) reload(ctx context.Context) error {
+	cfg, err := config.Load(s.path)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	toStart, toStop := diffRepositories(s.running, cfg.Repositories)
+
+	for _, rc := range toStart {
+		if cancel, ok := s.cancels[rc.Name]; ok {
+			log.Infof("repository %s configuration changed, restarting its sync loop", rc.Name)
+			cancel()
+		}
+
+		repoCtx, cancel := context.WithCancel(ctx)
+		s.cancels[rc.Name] = cancel
+		s.running[rc.Name] = rc
+
+		s.wg.Add(1)
+		go func(rc config.RepositoryConfig) {
+			defer s.wg.Done()
+			s.runRepository(repoCtx, rc)
+		}(rc)
+	}
+
+	for _, name := range toStop {
+		log.Infof("repository %s removed from configuration, stopping its sync loop", name)
+		s.cancels[name]()
+		delete(s.cancels, name)
+		delete(s.running, name)
+	}
+	return nil
+}
+
+// runRepository ticks rc.Interval(), running one synchronization pass against
+// rc on every tick, until ctx is done.
+func (s *Scheduler) runRepository(ctx context.Context, rc config.RepositoryConfig) {
+	interval, err := rc.Interval()
+	if err != nil {
+		log.Errorf("repository %s: %v", rc.Name, err)
+		return
+	}
+
+	r := repositoryFromConfig(rc)
+	opt := syncOptionsFromConfig(rc)
+	cmd := github.NewSyncCommandWithOptions(s.client, s.blobStore, &opt).
+		WithCheckpoint(storage.NewBlobCheckpoint(s.blobStore, opt.Storage))
+
+	runOnce := func() {
+		syncCtx, cancel := context.WithTimeout(ctx, interval)
+		defer cancel()
+		if err := cmd.Run(syncCtx, []*storage.Repository{r}); err != nil {
+			log.Errorf("repository %s: sync error: %v", rc.Name, err)
+		}
+	}
+
+	runOnce()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			runOnce()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package scheduler
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cmd/vossibility-collector/config"
+)
+
+func writeTempSchedulerConfig(t *testing.T, contents string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "scheduler_test")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("unexpected error writing temp config: %v", err)
+	}
+	return path
+}
+
+func TestDiffRepositoriesStartsNewRepositories(t *testing.T) {
+	running := map[string]config.RepositoryConfig{}
+	cfg := []config.RepositoryConfig{
+		{Name: "vmg/sundown", SyncInterval: "5m"},
+	}
+
+	toStart, toStop := diffRepositories(running, cfg)
+	if len(toStart) != 1 || toStart[0].Name != "vmg/sundown" {
+		t.Fatalf("toStart = %+v, want [vmg/sundown]", toStart)
+	}
+	if len(toStop) != 0 {
+		t.Fatalf("toStop = %v, want none", toStop)
+	}
+}
+
+func TestDiffRepositoriesLeavesUnchangedRepositoriesAlone(t *testing.T) {
+	rc := config.RepositoryConfig{Name: "vmg/sundown", SyncInterval: "5m"}
+	running := map[string]config.RepositoryConfig{"vmg/sundown": rc}
+
+	toStart, toStop := diffRepositories(running, []config.RepositoryConfig{rc})
+	if len(toStart) != 0 {
+		t.Fatalf("toStart = %+v, want none for an unchanged repository", toStart)
+	}
+	if len(toStop) != 0 {
+		t.Fatalf("toStop = %v, want none", toStop)
+	}
+}
+
+func TestDiffRepositoriesRestartsEditedRepositories(t *testing.T) {
+	running := map[string]config.RepositoryConfig{
+		"vmg/sundown": {Name: "vmg/sundown", SyncInterval: "5m"},
+	}
+	edited := config.RepositoryConfig{Name: "vmg/sundown", SyncInterval: "15m"}
+
+	toStart, toStop := diffRepositories(running, []config.RepositoryConfig{edited})
+	if len(toStart) != 1 || toStart[0] != edited {
+		t.Fatalf("toStart = %+v, want [%+v]", toStart, edited)
+	}
+	if len(toStop) != 0 {
+		t.Fatalf("toStop = %v, want none", toStop)
+	}
+}
+
+func TestDiffRepositoriesStopsRemovedRepositories(t *testing.T) {
+	running := map[string]config.RepositoryConfig{
+		"vmg/sundown":   {Name: "vmg/sundown", SyncInterval: "5m"},
+		"docker/docker": {Name: "docker/docker", SyncInterval: "15m"},
+	}
+	cfg := []config.RepositoryConfig{
+		{Name: "vmg/sundown", SyncInterval: "5m"},
+	}
+
+	toStart, toStop := diffRepositories(running, cfg)
+	if len(toStart) != 0 {
+		t.Fatalf("toStart = %+v, want none", toStart)
+	}
+	if len(toStop) != 1 || toStop[0] != "docker/docker" {
+		t.Fatalf("toStop = %v, want [docker/docker]", toStop)
+	}
+}
+
+// TestRunWaitsForTrackedGoroutines reproduces the checkpoint-loss class of
+// bug fixed in the sync package's own chunk0-4 fix, one layer up: Run must
+// not return until every goroutine reload started has actually exited, or a
+// caller that exits right after Run returns could kill one mid-sync and lose
+// whatever checkpoint commit it was in the middle of.
+//
+// A real runRepository goroutine needs a non-nil GitHub client and blob
+// store to run safely, so this test drives the same s.wg that reload
+// populates directly, rather than going through a config file.
+func TestRunWaitsForTrackedGoroutines(t *testing.T) {
+	path := writeTempSchedulerConfig(t, "repositories: []\n")
+
+	s := New(nil, nil, path)
+
+	finished := make(chan struct{})
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		time.Sleep(20 * time.Millisecond)
+		close(finished)
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run() did not return")
+	}
+
+	select {
+	case <-finished:
+	default:
+		t.Fatal("Run() returned before a goroutine tracked by its WaitGroup finished")
+	}
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"cmd/vossibility-collector/blob"
+)
+
+// checkpointKind is the blob kind under which checkpoints are persisted,
+// distinct from the kinds used for issues and pull requests.
+const checkpointKind = "checkpoint"
+
+// Checkpoint persists, per (repository, state filter) pair, the last
+// successfully indexed issue number, so an interrupted sync can resume where
+// it left off rather than starting over.
+type Checkpoint interface {
+	// LastIndexed returns the last successfully indexed issue number for r
+	// under stateFilter, or 0 if no checkpoint has been committed yet.
+	LastIndexed(ctx context.Context, r *Repository, stateFilter string) (int, error)
+
+	// Commit persists lastIndexed as the new checkpoint for r under
+	// stateFilter.
+	Commit(ctx context.Context, r *Repository, stateFilter string, lastIndexed int) error
+}
+
+// NopCheckpoint is a Checkpoint that never resumes and never persists
+// anything. It is the default used when no backing store is configured.
+type NopCheckpoint struct{}
+
+// LastIndexed always returns 0, nil.
+func (NopCheckpoint) LastIndexed(ctx context.Context, r *Repository, stateFilter string) (int, error) {
+	return 0, nil
+}
+
+// Commit is a no-op.
+func (NopCheckpoint) Commit(ctx context.Context, r *Repository, stateFilter string, lastIndexed int) error {
+	return nil
+}
+
+// blobCheckpoint is the default Checkpoint implementation, persisting
+// checkpoints as blobs in the same BlobStore used for synchronized data.
+type blobCheckpoint struct {
+	store   BlobStore
+	storage Storage
+}
+
+// NewBlobCheckpoint creates a Checkpoint backed by store, persisting its
+// checkpoints under the given Storage mode.
+func NewBlobCheckpoint(store BlobStore, s Storage) Checkpoint {
+	return &blobCheckpoint{store: store, storage: s}
+}
+
+type checkpointPayload struct {
+	LastIndexed int `json:"last_indexed"`
+}
+
+func checkpointID(r *Repository, stateFilter string) string {
+	return fmt.Sprintf("%s/%s/%s", r.User, r.Repo, stateFilter)
+}
+
+func (c *blobCheckpoint) LastIndexed(ctx context.Context, r *Repository, stateFilter string) (int, error) {
+	b, err := c.store.Get(ctx, c.storage, r, checkpointKind, checkpointID(r, stateFilter))
+	if err == ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var p checkpointPayload
+	if err := json.Unmarshal(b.Payload(), &p); err != nil {
+		return 0, err
+	}
+	return p.LastIndexed, nil
+}
+
+func (c *blobCheckpoint) Commit(ctx context.Context, r *Repository, stateFilter string, lastIndexed int) error {
+	payload, err := json.Marshal(checkpointPayload{LastIndexed: lastIndexed})
+	if err != nil {
+		return err
+	}
+
+	b, err := blob.NewBlobFromPayload(checkpointKind, checkpointID(r, stateFilter), payload)
+	if err != nil {
+		return err
+	}
+	return c.store.Store(ctx, c.storage, r, b)
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"cmd/vossibility-collector/blob"
+)
+
+// fakeBlobStore is a minimal in-memory BlobStore sufficient to exercise
+// blobCheckpoint without a real backend.
+type fakeBlobStore struct {
+	blobs map[string]*blob.Blob
+}
+
+func newFakeBlobStore() *fakeBlobStore {
+	return &fakeBlobStore{blobs: make(map[string]*blob.Blob)}
+}
+
+func (s *fakeBlobStore) key(kind, id string) string {
+	return kind + "/" + id
+}
+
+func (s *fakeBlobStore) Store(ctx context.Context, st Storage, r *Repository, b *blob.Blob) error {
+	s.blobs[s.key(b.Type(), b.ID())] = b
+	return nil
+}
+
+func (s *fakeBlobStore) Get(ctx context.Context, st Storage, r *Repository, kind, id string) (*blob.Blob, error) {
+	b, ok := s.blobs[s.key(kind, id)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return b, nil
+}
+
+func TestBlobCheckpointLastIndexedDefaultsToZero(t *testing.T) {
+	c := NewBlobCheckpoint(newFakeBlobStore(), StoreSnapshot)
+	r := &Repository{User: "vmg", Repo: "sundown"}
+
+	last, err := c.LastIndexed(context.Background(), r, "open")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if last != 0 {
+		t.Fatalf("LastIndexed() = %d, want 0 for a repository with no committed checkpoint", last)
+	}
+}
+
+func TestBlobCheckpointCommitThenLastIndexed(t *testing.T) {
+	c := NewBlobCheckpoint(newFakeBlobStore(), StoreSnapshot)
+	r := &Repository{User: "vmg", Repo: "sundown"}
+	ctx := context.Background()
+
+	if err := c.Commit(ctx, r, "open", 42); err != nil {
+		t.Fatalf("unexpected error committing checkpoint: %v", err)
+	}
+
+	last, err := c.LastIndexed(ctx, r, "open")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if last != 42 {
+		t.Fatalf("LastIndexed() = %d, want 42", last)
+	}
+}
+
+func TestBlobCheckpointCommitOverwritesPreviousValue(t *testing.T) {
+	c := NewBlobCheckpoint(newFakeBlobStore(), StoreSnapshot)
+	r := &Repository{User: "vmg", Repo: "sundown"}
+	ctx := context.Background()
+
+	if err := c.Commit(ctx, r, "open", 10); err != nil {
+		t.Fatalf("unexpected error committing checkpoint: %v", err)
+	}
+	if err := c.Commit(ctx, r, "open", 20); err != nil {
+		t.Fatalf("unexpected error committing checkpoint: %v", err)
+	}
+
+	last, err := c.LastIndexed(ctx, r, "open")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if last != 20 {
+		t.Fatalf("LastIndexed() = %d, want 20 after a second commit", last)
+	}
+}
+
+func TestBlobCheckpointIsScopedPerStateFilter(t *testing.T) {
+	c := NewBlobCheckpoint(newFakeBlobStore(), StoreSnapshot)
+	r := &Repository{User: "vmg", Repo: "sundown"}
+	ctx := context.Background()
+
+	if err := c.Commit(ctx, r, "open", 5); err != nil {
+		t.Fatalf("unexpected error committing checkpoint: %v", err)
+	}
+
+	last, err := c.LastIndexed(ctx, r, "closed")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if last != 0 {
+		t.Fatalf("LastIndexed() for a different state filter = %d, want 0", last)
+	}
+}
+
+func TestBlobCheckpointIsScopedPerRepository(t *testing.T) {
+	store := newFakeBlobStore()
+	c := NewBlobCheckpoint(store, StoreSnapshot)
+	ctx := context.Background()
+
+	if err := c.Commit(ctx, &Repository{User: "vmg", Repo: "sundown"}, "open", 5); err != nil {
+		t.Fatalf("unexpected error committing checkpoint: %v", err)
+	}
+
+	last, err := c.LastIndexed(ctx, &Repository{User: "docker", Repo: "docker"}, "open")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if last != 0 {
+		t.Fatalf("LastIndexed() for a different repository = %d, want 0", last)
+	}
+}
+
+func TestNopCheckpointNeverResumes(t *testing.T) {
+	c := NopCheckpoint{}
+	r := &Repository{User: "vmg", Repo: "sundown"}
+	ctx := context.Background()
+
+	if err := c.Commit(ctx, r, "open", 42); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	last, err := c.LastIndexed(ctx, r, "open")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if last != 0 {
+		t.Fatalf("LastIndexed() = %d, want 0: NopCheckpoint must never resume", last)
+	}
+}
@@ -0,0 +1,64 @@
+// Package storage defines the backends used to persist synchronized GitHub
+// data, along with the repository configuration used to describe what gets
+// synchronized.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"cmd/vossibility-collector/blob"
+)
+
+// Storage is the destination store for a synchronization job.
+type Storage string
+
+const (
+	// StoreSnapshot stores the latest known state of an item, overwriting any
+	// previous version.
+	StoreSnapshot Storage = "snapshot"
+
+	// StoreEvent stores every version of an item as a distinct event.
+	StoreEvent Storage = "event"
+)
+
+// RepositoryConfig holds the per-repository settings that can be defined
+// independently of the command line synchronization options.
+type RepositoryConfig struct {
+	// StartIndex is the default starting issue/pull-request number to use for
+	// this repository when none is specified on the command line.
+	StartIndex int
+}
+
+// Repository identifies a single GitHub repository to synchronize.
+type Repository struct {
+	User string
+	Repo string
+
+	RepositoryConfig RepositoryConfig
+}
+
+// PrettyName returns a human readable identifier for the repository, suitable
+// for logging.
+func (r *Repository) PrettyName() string {
+	return fmt.Sprintf("%s/%s", r.User, r.Repo)
+}
+
+// ErrNotFound is returned by BlobStore.Get when no blob matches the requested
+// type and id.
+var ErrNotFound = errors.New("storage: blob not found")
+
+// BlobStore is the interface implemented by backends able to persist blobs of
+// synchronized GitHub data.
+type BlobStore interface {
+	// Store persists b under the given Storage mode for the repository r.
+	// Implementations must return ctx.Err() promptly if ctx is cancelled
+	// before or during the operation.
+	Store(ctx context.Context, s Storage, r *Repository, b *blob.Blob) error
+
+	// Get retrieves the blob of the given kind and id previously persisted
+	// for the repository r under the given Storage mode. It returns
+	// ErrNotFound if no such blob exists.
+	Get(ctx context.Context, s Storage, r *Repository, kind, id string) (*blob.Blob, error)
+}
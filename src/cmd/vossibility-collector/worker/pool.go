@@ -0,0 +1,124 @@
+// Package worker provides a small generic worker pool used to pipeline
+// fetch/index style work across a bounded number of goroutines.
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Job is a single unit of work submitted to a Pool.
+type Job interface{}
+
+// Result pairs a Job with the outcome of running it through a Pool's Func.
+type Result struct {
+	Job    Job
+	Result interface{}
+	Err    error
+}
+
+// Func processes a single Job and returns its result, or an error if the job
+// could not be completed. Func must respect ctx cancellation.
+type Func func(ctx context.Context, j Job) (interface{}, error)
+
+// Pool runs a Func over jobs submitted on In with a bounded number of
+// goroutines, publishing every outcome (success or failure) on Out.
+//
+// A panic recovered from within Func is turned into a Result with a non-nil
+// Err rather than taking down the process, so a single bad job cannot crash
+// the pipeline.
+//
+// Once ctx is cancelled, a worker that finishes a job while nobody is
+// reading Out drops that Result and exits rather than blocking forever on
+// the send. This keeps Wait from hanging when a downstream consumer (such
+// as another Pool chained off of Out) has itself already stopped draining
+// because of the same cancellation.
+type Pool struct {
+	in  chan Job
+	out chan Result
+
+	fn          Func
+	concurrency int
+
+	wg sync.WaitGroup
+}
+
+// NewPool creates a Pool running fn over concurrency goroutines. The
+// in-channel and out-channel are both created with a capacity equal to
+// concurrency, which gives a small amount of back-pressure without forcing
+// callers to size channels themselves.
+func NewPool(concurrency int, fn Func) *Pool {
+	return &Pool{
+		in:          make(chan Job, concurrency),
+		out:         make(chan Result, concurrency),
+		fn:          fn,
+		concurrency: concurrency,
+	}
+}
+
+// In returns the channel jobs should be submitted on. Callers must close it
+// once done submitting work.
+func (p *Pool) In() chan<- Job {
+	return p.in
+}
+
+// Out returns the channel on which every Result is published, in completion
+// order. It is closed once all workers have exited, which happens either
+// because In was closed and drained, or because ctx was cancelled.
+func (p *Pool) Out() <-chan Result {
+	return p.out
+}
+
+// Start launches the pool's worker goroutines. It returns immediately; call
+// Wait to block until every worker has exited. Out is closed by a separate
+// goroutine once they have, so it may still be open when Wait returns.
+func (p *Pool) Start(ctx context.Context) {
+	p.wg.Add(p.concurrency)
+	for i := 0; i != p.concurrency; i++ {
+		go p.work(ctx)
+	}
+	go func() {
+		p.wg.Wait()
+		close(p.out)
+	}()
+}
+
+// Wait blocks until every worker goroutine has exited.
+func (p *Pool) Wait() {
+	p.wg.Wait()
+}
+
+func (p *Pool) work(ctx context.Context) {
+	defer p.wg.Done()
+	for {
+		select {
+		case j, ok := <-p.in:
+			if !ok {
+				return
+			}
+			res := p.run(ctx, j)
+			// Out may have no reader left once ctx is cancelled (a consumer
+			// downstream is free to stop draining as soon as it observes
+			// cancellation itself), so this send must not block forever.
+			select {
+			case p.out <- res:
+			case <-ctx.Done():
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *Pool) run(ctx context.Context, j Job) (res Result) {
+	res.Job = j
+	defer func() {
+		if r := recover(); r != nil {
+			res.Err = fmt.Errorf("worker: recovered from panic: %v", r)
+		}
+	}()
+	res.Result, res.Err = p.fn(ctx, j)
+	return res
+}
@@ -0,0 +1,217 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func drain(p *Pool) []Result {
+	var results []Result
+	for r := range p.Out() {
+		results = append(results, r)
+	}
+	return results
+}
+
+func TestPoolSuccess(t *testing.T) {
+	p := NewPool(4, func(ctx context.Context, j Job) (interface{}, error) {
+		return j.(int) * 2, nil
+	})
+	p.Start(context.Background())
+
+	for i := 0; i != 10; i++ {
+		p.In() <- i
+	}
+	close(p.in)
+
+	results := drain(p)
+	if len(results) != 10 {
+		t.Fatalf("expected 10 results, got %d", len(results))
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			t.Fatalf("unexpected error: %v", r.Err)
+		}
+		if r.Result.(int) != r.Job.(int)*2 {
+			t.Fatalf("unexpected result %v for job %v", r.Result, r.Job)
+		}
+	}
+}
+
+func TestPoolErrorSurfaced(t *testing.T) {
+	wantErr := errors.New("boom")
+	p := NewPool(2, func(ctx context.Context, j Job) (interface{}, error) {
+		return nil, wantErr
+	})
+	p.Start(context.Background())
+
+	p.In() <- 1
+	close(p.in)
+
+	results := drain(p)
+	if len(results) != 1 || results[0].Err != wantErr {
+		t.Fatalf("expected job error to be surfaced, got %+v", results)
+	}
+}
+
+func TestPoolPanicRecovered(t *testing.T) {
+	p := NewPool(1, func(ctx context.Context, j Job) (interface{}, error) {
+		panic("kaboom")
+	})
+	p.Start(context.Background())
+
+	p.In() <- 1
+	close(p.in)
+
+	results := drain(p)
+	if len(results) != 1 || results[0].Err == nil {
+		t.Fatalf("expected panic to be recovered into an error, got %+v", results)
+	}
+}
+
+// TestPoolExitsWhenDownstreamStopsDraining reproduces the deadlock a
+// downstream consumer that stops reading Out() (as happens once a consumer
+// itself observes ctx cancellation, e.g. github/sync.go's fetch->index
+// forwarder) used to cause: a worker that finishes a job while Out's
+// one-slot-per-concurrency buffer is already full from an earlier, unread
+// result must still be able to exit once ctx is cancelled, rather than
+// blocking forever on the send.
+func TestPoolExitsWhenDownstreamStopsDraining(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	aboutToEmitSecond := make(chan struct{})
+	p := NewPool(1, func(ctx context.Context, j Job) (interface{}, error) {
+		if j.(int) == 2 {
+			close(aboutToEmitSecond)
+		}
+		return j, nil
+	})
+	p.Start(ctx)
+
+	// Job 1's result is left to sit unread in Out's one-slot buffer, as if a
+	// downstream consumer had already stopped draining it. Job 2 then gives
+	// the worker a second result with nowhere to go.
+	p.In() <- 1
+	p.In() <- 2
+	<-aboutToEmitSecond
+
+	// Nobody ever reads p.Out() in this test: at this point the worker is
+	// on the verge of trying to send job 2's result into an already-full
+	// buffer that will never drain, which is exactly the situation a
+	// cancelled ctx must be able to interrupt.
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		p.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("pool did not exit: a worker blocked forever trying to emit a result nobody was draining")
+	}
+}
+
+// TestChainedPoolsExitWhenDownstreamIsSaturated mirrors the two-pool
+// fetch->index pipeline built in github/sync.go: a forwarder goroutine
+// drains one pool's Out() and feeds the result into a second pool's In().
+// It reproduces the scenario reported against chunk0-2, where a saturated
+// downstream pool causes the forwarder to block forever, which in turn fills
+// the upstream pool's Out buffer and leaves its worker blocked forever too.
+func TestChainedPoolsExitWhenDownstreamIsSaturated(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// downstream never finishes a job, simulating a consumer that has
+	// stopped making progress. With its single worker stuck and its
+	// one-slot In buffer filled below, it cannot accept another job.
+	neverReleased := make(chan struct{})
+	downstream := NewPool(1, func(ctx context.Context, j Job) (interface{}, error) {
+		<-neverReleased
+		return j, nil
+	})
+	downstream.Start(ctx)
+	downstream.In() <- "occupies-the-worker"
+	downstream.In() <- "occupies-the-buffer"
+
+	// upstream is the pool under test. The forwarder below mirrors the
+	// forwarding loop of github/sync.go's fetch->index glue, including
+	// stopping on ctx.Done() when it cannot forward a result.
+	aboutToEmitThird := make(chan struct{})
+	upstream := NewPool(1, func(ctx context.Context, j Job) (interface{}, error) {
+		if j.(int) == 3 {
+			close(aboutToEmitThird)
+		}
+		return j, nil
+	})
+	upstream.Start(ctx)
+
+	go func() {
+		defer close(downstream.in)
+		for res := range upstream.Out() {
+			select {
+			case downstream.In() <- res.Result:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Job 1's result is forwarded into downstream, where it blocks the
+	// forwarder forever (downstream is fully saturated). Job 2's result
+	// then fills upstream's own Out buffer once the forwarder stops
+	// draining it. Job 3 gives upstream's worker a third result with
+	// nowhere to go.
+	upstream.In() <- 1
+	upstream.In() <- 2
+	upstream.In() <- 3
+	<-aboutToEmitThird
+
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		upstream.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("upstream pool did not exit once its downstream consumer stalled after cancellation")
+	}
+}
+
+func TestPoolCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	block := make(chan struct{})
+
+	p := NewPool(1, func(ctx context.Context, j Job) (interface{}, error) {
+		close(started)
+		<-block
+		return nil, nil
+	})
+	p.Start(ctx)
+
+	p.In() <- 1
+
+	<-started
+	cancel()
+	close(block)
+
+	done := make(chan struct{})
+	go func() {
+		p.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("pool did not shut down after context cancellation")
+	}
+}